@@ -0,0 +1,189 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+const (
+	// cacheDirName is the default directory keeping verified downloaded
+	// archives, relative to the tools directory.
+	cacheDirName = "cache"
+	// defaultCacheSizeLimit is the default total size of cached archives
+	// before the least recently used ones are evicted.
+	defaultCacheSizeLimit = 1 << 30 // 1 GiB
+	// checksumSuffix is appended to the archive name for the cached
+	// checksum records kept next to the content-addressed archives.
+	checksumSuffix = ".sha256"
+)
+
+// archiveCache keeps verified release archives under content-addressed
+// names (the hex-encoded SHA256 of the archive), so that re-installing a
+// previously fetched version requires no network and identical archives are
+// stored only once.
+type archiveCache struct {
+	dir       string
+	sizeLimit int64
+}
+
+// path returns the content-addressed location of the archive with the given
+// checksum.
+func (c *archiveCache) path(hash string) string {
+	return filepath.Join(c.dir, hash)
+}
+
+// isArchiveName reports whether name is a content-addressed archive entry,
+// i.e. the hex-encoded SHA256 checksum of its content.
+func isArchiveName(name string) bool {
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// get returns the path of the cached archive with the given checksum,
+// or an empty path if it is not cached. A cached file that no longer
+// matches its name is removed as corrupted. Hits are re-stamped to keep
+// eviction ordered by last use.
+func (c *archiveCache) get(hash string) (string, error) {
+	path := c.path(hash)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+
+	actual, err := sha256File(path)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	if actual != hash {
+		if err := os.Remove(path); err != nil {
+			return "", trace.ConvertSystemError(err)
+		}
+		return "", nil
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+
+	return path, nil
+}
+
+// getHash returns the cached checksum recorded for the given archive name,
+// or an empty string if none was recorded. It lets a fully cached version be
+// re-installed without any network round trips.
+func (c *archiveCache) getHash(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, name+checksumSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+
+	return string(data), nil
+}
+
+// putHash records the checksum of the given archive name next to the
+// content-addressed archives.
+func (c *archiveCache) putHash(name, hash string) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return trace.ConvertSystemError(os.WriteFile(filepath.Join(c.dir, name+checksumSuffix), []byte(hash), 0o644))
+}
+
+// put moves the verified archive at srcPath into the cache under its
+// content-addressed name and evicts the least recently used archives over
+// the size limit. It returns the final location of the archive.
+func (c *archiveCache) put(srcPath, hash string) (string, error) {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+	path := c.path(hash)
+	if err := os.Rename(srcPath, path); err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+	if err := c.prune(hash); err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	return path, nil
+}
+
+// prune removes the least recently used archives until the cache fits the
+// size limit, always keeping the just-added archive so it can still be
+// extracted. A zero or negative limit disables eviction.
+func (c *archiveCache) prune(keep string) error {
+	if c.sizeLimit <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		// Only content-addressed archives are evicted. Checksum records,
+		// the lock file, the negative-lookup cache and in-flight download
+		// temporaries share the directory and must survive pruning.
+		if entry.IsDir() || entry.Name() == keep || !isArchiveName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return trace.ConvertSystemError(err)
+		}
+		infos = append(infos, info)
+	}
+	// Most recently used archives are kept, the rest is evicted once the
+	// accumulated size exceeds the limit.
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	var total int64
+	for _, info := range infos {
+		total += info.Size()
+		if total <= c.sizeLimit {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, info.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return trace.ConvertSystemError(err)
+		}
+	}
+
+	return nil
+}
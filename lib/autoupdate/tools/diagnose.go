@@ -0,0 +1,247 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/utils"
+)
+
+// DiagnosticCheck is the outcome of a single updater health check.
+type DiagnosticCheck struct {
+	// Name identifies the check.
+	Name string `json:"name"`
+	// OK reports whether the check passed.
+	OK bool `json:"ok"`
+	// Details describes the outcome in human-readable form.
+	Details string `json:"details,omitempty"`
+}
+
+// DiagnosticReport summarizes the state of the updater on this machine,
+// suitable for printing or attaching to a support ticket.
+type DiagnosticReport struct {
+	// ToolsDir is the tools directory the updater manages.
+	ToolsDir string `json:"tools_dir"`
+	// LocalVersion is the version of the currently running client tools.
+	LocalVersion string `json:"local_version"`
+	// PinnedVersion is the TELEPORT_TOOLS_VERSION pin, if set.
+	PinnedVersion string `json:"pinned_version,omitempty"`
+	// InstalledVersion is the version recorded in the install manifest,
+	// if any version was installed by the updater.
+	InstalledVersion string `json:"installed_version,omitempty"`
+	// Checks are the individual health check outcomes.
+	Checks []DiagnosticCheck `json:"checks"`
+}
+
+// OK reports whether all checks passed.
+func (r *DiagnosticReport) OK() bool {
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the report in human-readable form.
+func (r *DiagnosticReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "tools directory: %v\n", r.ToolsDir)
+	fmt.Fprintf(&sb, "local version: %v\n", r.LocalVersion)
+	if r.PinnedVersion != "" {
+		fmt.Fprintf(&sb, "pinned version: %v\n", r.PinnedVersion)
+	}
+	if r.InstalledVersion != "" {
+		fmt.Fprintf(&sb, "installed version: %v\n", r.InstalledVersion)
+	}
+	for _, check := range r.Checks {
+		status := "ok"
+		if !check.OK {
+			status = "failed"
+		}
+		fmt.Fprintf(&sb, "%v: %v", check.Name, status)
+		if check.Details != "" {
+			fmt.Fprintf(&sb, " (%v)", check.Details)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// Diagnose runs the updater health checks: connectivity to the configured
+// mirror, availability of the tools directory lock, tools directory
+// ownership and permissions, free disk space and version resolution.
+// Individual failures are recorded in the report rather than returned as an
+// error, so support teams always get the full picture.
+func (u *Updater) Diagnose(ctx context.Context) *DiagnosticReport {
+	report := &DiagnosticReport{
+		ToolsDir:      u.toolsDir,
+		LocalVersion:  u.localVersion,
+		PinnedVersion: os.Getenv(teleportToolsVersionEnv),
+	}
+	if m, err := readManifest(u.toolsDir); err == nil && m != nil {
+		report.InstalledVersion = m.Version
+	}
+
+	report.Checks = append(report.Checks,
+		u.diagnoseConnectivity(ctx),
+		u.diagnoseLock(),
+		u.diagnoseToolsDir(),
+		u.diagnoseDiskSpace(),
+		u.diagnoseVersionResolution(ctx),
+	)
+
+	return report
+}
+
+// diagnoseConnectivity verifies that the configured mirror is reachable.
+// A missing release index still proves connectivity.
+func (u *Updater) diagnoseConnectivity(ctx context.Context) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "connectivity", Details: u.baseURL}
+	body, _, err := u.artifactTransport().Get(ctx, ArtifactRef{Name: releaseIndexName})
+	if err == nil {
+		body.Close()
+	}
+	if err != nil && !trace.IsNotFound(err) {
+		check.Details = err.Error()
+		return check
+	}
+	check.OK = true
+
+	return check
+}
+
+// diagnoseLock verifies that the tools directory lock can be acquired, i.e.
+// no other process is holding it.
+func (u *Updater) diagnoseLock() DiagnosticCheck {
+	check := DiagnosticCheck{Name: "lock"}
+	if _, err := os.Stat(u.toolsDir); errors.Is(err, os.ErrNotExist) {
+		check.OK = true
+		check.Details = "tools directory does not exist yet"
+		return check
+	}
+	unlock, err := utils.FSTryWriteLock(filepath.Join(u.toolsDir, lockFileName))
+	if err != nil {
+		if errors.Is(err, utils.ErrUnsuccessfulLockTry) {
+			check.Details = "lock is held by another process"
+		} else {
+			check.Details = err.Error()
+		}
+		return check
+	}
+	if err := unlock(); err != nil {
+		check.Details = err.Error()
+		return check
+	}
+	check.OK = true
+
+	return check
+}
+
+// diagnoseToolsDir verifies the ownership and permissions of the tools
+// directory.
+func (u *Updater) diagnoseToolsDir() DiagnosticCheck {
+	check := DiagnosticCheck{Name: "tools-dir"}
+	if isPerMachineInstall(u.toolsDir) {
+		check.Details = "tools directory is in a per-machine install location"
+		return check
+	}
+	if err := u.checkSecureDir(u.toolsDir); err != nil {
+		check.Details = err.Error()
+		return check
+	}
+	check.OK = true
+
+	return check
+}
+
+// diagnoseDiskSpace verifies that the filesystem holding the tools directory
+// is not about to run out of space.
+func (u *Updater) diagnoseDiskSpace() DiagnosticCheck {
+	dir := u.toolsDir
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		dir = filepath.Dir(dir)
+	}
+	percentUsed, err := utils.PercentUsed(dir)
+
+	return diskSpaceCheck(percentUsed, err)
+}
+
+// diskSpaceCheck converts the filesystem utilization reported for the tools
+// directory into a check outcome. Platforms without utilization reporting
+// (Windows) pass the check instead of permanently failing the report.
+func diskSpaceCheck(percentUsed float64, err error) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "disk-space"}
+	if trace.IsNotImplemented(err) {
+		check.OK = true
+		check.Details = "disk usage reporting is not supported on this platform"
+		return check
+	}
+	if err != nil {
+		check.Details = err.Error()
+		return check
+	}
+	check.Details = fmt.Sprintf("%.0f%% used", percentUsed)
+	check.OK = percentUsed < 95
+
+	return check
+}
+
+// diagnoseVersionResolution verifies that the version the updater would
+// install, the pinned one when set, is available on the mirror.
+func (u *Updater) diagnoseVersionResolution(ctx context.Context) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "version-resolution"}
+	pinned := os.Getenv(teleportToolsVersionEnv)
+	if pinned == "off" {
+		check.OK = true
+		check.Details = "automatic updates are disabled"
+		return check
+	}
+	if pinned == "" {
+		check.OK = true
+		check.Details = "no version pinned, following the cluster"
+		return check
+	}
+
+	name, err := ArchiveName(pinned, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		check.Details = err.Error()
+		return check
+	}
+	if _, err := u.downloadHash(ctx, ArtifactRef{Version: pinned, Name: name + ".sha256"}); err != nil {
+		if trace.IsNotFound(err) {
+			check.Details = fmt.Sprintf("pinned version %v does not exist on the mirror", pinned)
+		} else {
+			check.Details = err.Error()
+		}
+		return check
+	}
+	check.OK = true
+	check.Details = fmt.Sprintf("pinned version %v is available", pinned)
+
+	return check
+}
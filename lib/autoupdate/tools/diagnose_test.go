@@ -0,0 +1,67 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"testing"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskSpaceCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		percentUsed float64
+		err         error
+		wantOK      bool
+		wantDetails string
+	}{
+		{
+			name:        "plenty of space",
+			percentUsed: 42,
+			wantOK:      true,
+			wantDetails: "42% used",
+		},
+		{
+			name:        "almost full",
+			percentUsed: 99,
+			wantOK:      false,
+			wantDetails: "99% used",
+		},
+		{
+			name:        "not implemented passes",
+			err:         trace.NotImplemented("disk usage not supported"),
+			wantOK:      true,
+			wantDetails: "disk usage reporting is not supported on this platform",
+		},
+		{
+			name:        "other errors fail",
+			err:         trace.AccessDenied("permission denied"),
+			wantOK:      false,
+			wantDetails: "permission denied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := diskSpaceCheck(tt.percentUsed, tt.err)
+			require.Equal(t, "disk-space", check.Name)
+			require.Equal(t, tt.wantOK, check.OK)
+			require.Equal(t, tt.wantDetails, check.Details)
+		})
+	}
+}
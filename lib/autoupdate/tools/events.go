@@ -0,0 +1,97 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+// EventKind identifies the kind of a structured updater event.
+type EventKind string
+
+// EventOutdatedPin is emitted when the client tools are pinned to a version
+// older than the one the cluster advertises.
+const EventOutdatedPin EventKind = "outdated-pin"
+
+// Event is a structured event describing a noteworthy updater condition.
+type Event struct {
+	// Kind identifies the event.
+	Kind EventKind `json:"kind"`
+	// PinnedVersion is the version the user pinned the client tools to,
+	// if any.
+	PinnedVersion string `json:"pinned_version,omitempty"`
+	// TargetVersion is the client tools version the cluster advertises.
+	TargetVersion string `json:"target_version,omitempty"`
+}
+
+// EventSink receives structured events from the updater, e.g. for telemetry
+// or audit purposes. Implementations must not block for long: events are
+// emitted on the command path.
+type EventSink interface {
+	// Emit delivers the event.
+	Emit(ctx context.Context, event Event)
+}
+
+// WithEventSink defines a sink receiving structured updater events in
+// addition to the log warnings.
+func WithEventSink(sink EventSink) Option {
+	return func(u *Updater) {
+		u.eventSink = sink
+	}
+}
+
+// WarnOnOutdatedPin compares the version the client tools are pinned to via
+// TELEPORT_TOOLS_VERSION against the target version the cluster advertises.
+// When the pin is older it logs a prominent warning describing the pin, the
+// cluster's target version and how to unpin, and emits an [EventOutdatedPin]
+// event to the configured sink. The pin is still obeyed, the command is
+// never blocked.
+func (u *Updater) WarnOnOutdatedPin(ctx context.Context, targetVersion string) {
+	pinned := os.Getenv(teleportToolsVersionEnv)
+	if pinned == "" || pinned == "off" {
+		return
+	}
+	pinnedVersion, err := semver.NewVersion(strings.TrimPrefix(pinned, "v"))
+	if err != nil {
+		return
+	}
+	clusterVersion, err := semver.NewVersion(strings.TrimPrefix(targetVersion, "v"))
+	if err != nil {
+		return
+	}
+	if !pinnedVersion.LessThan(*clusterVersion) {
+		return
+	}
+
+	slog.WarnContext(ctx, "Client tools are pinned to a version older than the one required by the cluster, "+
+		"unset "+teleportToolsVersionEnv+" to resume automatic updates",
+		"pinned_version", pinned,
+		"cluster_version", targetVersion,
+	)
+	if u.eventSink != nil {
+		u.eventSink.Emit(ctx, Event{
+			Kind:          EventOutdatedPin,
+			PinnedVersion: pinned,
+			TargetVersion: targetVersion,
+		})
+	}
+}
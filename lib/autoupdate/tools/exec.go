@@ -0,0 +1,70 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/gravitational/trace"
+)
+
+// Exec re-executes the updater-managed copy of the currently running tool
+// from the tools directory with the same arguments and environment,
+// returning the exit code of the child process. The managed per-user copy is
+// always preferred; a per-machine system install (e.g. under Program Files
+// on Windows) is left untouched.
+func (u *Updater) Exec() (int, error) {
+	// Never auto-execute binaries from a directory other users can
+	// tamper with.
+	if err := u.checkSecureDir(u.toolsDir); err != nil {
+		return 0, trace.Wrap(err)
+	}
+	executablePath, err := os.Executable()
+	if err != nil {
+		return 0, trace.Wrap(err)
+	}
+	toolPath := filepath.Join(u.toolsDir, filepath.Base(executablePath))
+	if _, err := os.Stat(toolPath); errors.Is(err, fs.ErrNotExist) {
+		return 0, trace.NotFound("%q is not installed in %q", filepath.Base(executablePath), u.toolsDir)
+	} else if err != nil {
+		return 0, trace.ConvertSystemError(err)
+	}
+
+	// Disable the version check in the child process to never re-exec
+	// recursively.
+	env := append(os.Environ(), teleportToolsVersionEnv+"=off")
+
+	cmd := exec.Command(toolPath, os.Args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, trace.Wrap(err)
+	}
+
+	return 0, nil
+}
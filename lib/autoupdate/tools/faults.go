@@ -0,0 +1,90 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"io"
+
+	"github.com/gravitational/trace"
+)
+
+// FaultPoint identifies a stage of the update flow at which a fault hook is
+// invoked.
+type FaultPoint string
+
+const (
+	// FaultAcquireLock is invoked after the tools directory lock was
+	// acquired, before any files are touched.
+	FaultAcquireLock FaultPoint = "acquire-lock"
+	// FaultDownloadStart is invoked before the archive download request
+	// is sent.
+	FaultDownloadStart FaultPoint = "download-start"
+	// FaultDownloadChunk is invoked after each chunk of the archive body
+	// is read, allowing mid-download disconnects and slow-network
+	// simulation.
+	FaultDownloadChunk FaultPoint = "download-chunk"
+	// FaultVerifyChecksum is invoked before the downloaded archive is
+	// compared against the advertised checksum.
+	FaultVerifyChecksum FaultPoint = "verify-checksum"
+	// FaultExtract is invoked before the verified archive is extracted
+	// into the tools directory.
+	FaultExtract FaultPoint = "extract"
+)
+
+// FaultHook is called by the updater at well-known points of the update
+// flow. Returning an error aborts the current stage with that error; the
+// hook may also block to simulate slow disks or networks. Hooks are meant
+// for resilience testing only and are never installed by default.
+type FaultHook func(point FaultPoint) error
+
+// WithFaultHook installs a fault-injection hook invoked at well-known points
+// of the update flow. It is intended for integration tests and CI that need
+// to deterministically exercise retry, resume and rollback logic; production
+// code must not set it.
+func WithFaultHook(hook FaultHook) Option {
+	return func(u *Updater) {
+		u.faultHook = hook
+	}
+}
+
+// fault invokes the configured fault hook at the given point, if any.
+func (u *Updater) fault(point FaultPoint) error {
+	if u.faultHook == nil {
+		return nil
+	}
+	return trace.Wrap(u.faultHook(point))
+}
+
+// faultReader wraps the archive download body and consults the fault hook
+// after each read, allowing tests to cut the connection mid-download. The
+// hook runs after data was read so an injected disconnect triggers
+// deterministically even when a small body is returned in a single read
+// together with io.EOF.
+type faultReader struct {
+	reader io.Reader
+	fault  func(point FaultPoint) error
+}
+
+func (r *faultReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 || err == nil {
+		if faultErr := r.fault(FaultDownloadChunk); faultErr != nil {
+			return n, trace.Wrap(faultErr)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,148 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/gravitational/trace"
+)
+
+// manifestFileName is the name of the file in the tools directory where the
+// updater records the files it installed along with their checksums.
+const manifestFileName = ".update-manifest.json"
+
+var (
+	// ErrUnmanagedTool designates an error when the tools directory contains
+	// a binary that was not installed by the updater, e.g. a custom build
+	// that was dropped in manually.
+	ErrUnmanagedTool = errors.New("tool was not installed by the updater")
+	// ErrToolModified designates an error when a binary installed by the
+	// updater was modified after installation.
+	ErrToolModified = errors.New("tool was modified after installation")
+)
+
+// Manifest tracks the files owned by the updater in an installation
+// directory.
+type Manifest struct {
+	// Version is the client tools version the files were installed from.
+	Version string `json:"version"`
+	// Checksums maps the file names installed by the updater to the
+	// hex-encoded SHA256 checksum recorded at installation time.
+	Checksums map[string]string `json:"checksums"`
+}
+
+// readManifest reads the manifest from dir, returning nil without an error
+// if no manifest was written yet.
+func readManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return &m, nil
+}
+
+// writeManifest records the checksums of the tool binaries currently present
+// in dir for the given version, marking them as owned by the updater.
+func (u *Updater) writeManifest(dir, toolsVersion string) (*Manifest, error) {
+	m := Manifest{
+		Version:   toolsVersion,
+		Checksums: make(map[string]string),
+	}
+	for _, tool := range u.tools {
+		hash, err := sha256File(filepath.Join(dir, tool))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		m.Checksums[tool] = hash
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestFileName), data, 0o644); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	return &m, nil
+}
+
+// checkOwnership verifies that each tool binary present in dir was installed
+// by the updater and was not modified since, so that a subsequent
+// installation does not clobber files the updater does not own.
+func (u *Updater) checkOwnership(dir string) error {
+	m, err := readManifest(dir)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	for _, tool := range u.tools {
+		hash, err := sha256File(filepath.Join(dir, tool))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		if m == nil {
+			return trace.Wrap(ErrUnmanagedTool, "refusing to overwrite %q in %q", tool, dir)
+		}
+		recorded, ok := m.Checksums[tool]
+		if !ok {
+			return trace.Wrap(ErrUnmanagedTool, "refusing to overwrite %q in %q", tool, dir)
+		}
+		if recorded != hash {
+			return trace.Wrap(ErrToolModified, "refusing to overwrite %q in %q", tool, dir)
+		}
+	}
+
+	return nil
+}
+
+// sha256File returns the hex-encoded SHA256 checksum of the file at path.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
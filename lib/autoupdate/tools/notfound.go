@@ -0,0 +1,194 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/gravitational/trace"
+)
+
+const (
+	// notFoundFileName is the name of the negative lookup cache kept next
+	// to the content-addressed archives.
+	notFoundFileName = ".notfound.json"
+	// negativeCacheTTL is how long a missing version is remembered before
+	// the CDN is queried for it again.
+	negativeCacheTTL = 5 * time.Minute
+	// releaseIndexName is the name of the release index artifact on the
+	// mirror, listing the available versions one per line.
+	releaseIndexName = "releases"
+)
+
+// ErrVersionNotFound designates an error when the requested client tools
+// version does not exist on the CDN.
+var ErrVersionNotFound = errors.New("requested version not found")
+
+// notFoundEntry records a missing archive along with the closest available
+// version suggested at the time of the failed lookup.
+type notFoundEntry struct {
+	// Expires is when the negative result must be re-validated against
+	// the CDN.
+	Expires time.Time `json:"expires"`
+	// Suggestion is the closest available version from the release index,
+	// if it could be determined.
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// getNotFound returns the fresh negative lookup entry recorded for the given
+// archive name, or nil if there is none or it expired.
+func (c *archiveCache) getNotFound(name string) (*notFoundEntry, error) {
+	entries, err := c.readNotFound()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	entry, ok := entries[name]
+	if !ok || time.Now().After(entry.Expires) {
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+// putNotFound records a negative lookup for the given archive name with a
+// short TTL, so subsequent runs fail fast instead of re-querying the CDN.
+func (c *archiveCache) putNotFound(name, suggestion string) error {
+	entries, err := c.readNotFound()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	// Expired records are dropped while the file is rewritten anyway.
+	now := time.Now()
+	for key, entry := range entries {
+		if now.After(entry.Expires) {
+			delete(entries, key)
+		}
+	}
+	entries[name] = notFoundEntry{
+		Expires:    now.Add(negativeCacheTTL),
+		Suggestion: suggestion,
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return trace.ConvertSystemError(os.WriteFile(filepath.Join(c.dir, notFoundFileName), data, 0o644))
+}
+
+func (c *archiveCache) readNotFound() (map[string]notFoundEntry, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, notFoundFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return make(map[string]notFoundEntry), nil
+	}
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	entries := make(map[string]notFoundEntry)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return entries, nil
+}
+
+// versionNotFoundError returns [ErrVersionNotFound] annotated with the
+// requested version and the closest available one, when known.
+func versionNotFoundError(toolsVersion, suggestion string) error {
+	if suggestion != "" {
+		return trace.Wrap(ErrVersionNotFound, "version %v does not exist, closest available version is %v", toolsVersion, suggestion)
+	}
+	return trace.Wrap(ErrVersionNotFound, "version %v does not exist", toolsVersion)
+}
+
+// suggestVersion makes a best-effort attempt to find the closest available
+// version to the requested one in the release index of the CDN, returning an
+// empty string when the index is unavailable.
+func (u *Updater) suggestVersion(ctx context.Context, toolsVersion string) string {
+	body, _, err := u.artifactTransport().Get(ctx, ArtifactRef{Name: releaseIndexName})
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	var available []string
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		if version := strings.TrimSpace(scanner.Text()); version != "" {
+			available = append(available, version)
+		}
+	}
+
+	return closestVersion(toolsVersion, available)
+}
+
+// closestVersion returns the version from available closest to target,
+// comparing the major, minor and patch distances in that order.
+func closestVersion(target string, available []string) string {
+	targetVersion, err := semver.NewVersion(strings.TrimPrefix(target, "v"))
+	if err != nil {
+		return ""
+	}
+
+	var closest string
+	var closestDistance [3]int64
+	for _, candidate := range available {
+		candidateVersion, err := semver.NewVersion(strings.TrimPrefix(candidate, "v"))
+		if err != nil {
+			continue
+		}
+		distance := [3]int64{
+			abs64(candidateVersion.Major - targetVersion.Major),
+			abs64(candidateVersion.Minor - targetVersion.Minor),
+			abs64(candidateVersion.Patch - targetVersion.Patch),
+		}
+		if closest == "" || less(distance, closestDistance) {
+			closest = candidate
+			closestDistance = distance
+		}
+	}
+
+	return closest
+}
+
+func less(a, b [3]int64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,44 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !windows
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/gravitational/trace"
+)
+
+// userToolsDir returns the default per-user tools directory
+// ($HOME/.tsh/bin).
+func userToolsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	return filepath.Join(home, ".tsh", "bin"), nil
+}
+
+// isPerMachineInstall reports whether path is under a system-wide
+// installation prefix. Install scope detection only applies to the
+// per-machine MSI installs on Windows.
+func isPerMachineInstall(path string) bool {
+	return false
+}
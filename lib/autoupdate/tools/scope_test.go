@@ -0,0 +1,83 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPerMachineInstallPath(t *testing.T) {
+	programFiles := filepath.Join(t.TempDir(), "Program Files")
+	programFilesX86 := filepath.Join(t.TempDir(), "Program Files (x86)")
+	prefixes := []string{programFiles, programFilesX86, ""}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{
+			name: "under primary prefix",
+			path: filepath.Join(programFiles, "Teleport", "tsh.exe"),
+			want: true,
+		},
+		{
+			name: "under secondary prefix",
+			path: filepath.Join(programFilesX86, "Teleport", "tsh.exe"),
+			want: true,
+		},
+		{
+			name: "equal to prefix",
+			path: programFiles,
+			want: true,
+		},
+		{
+			name: "sibling of prefix",
+			path: programFiles + " Extra",
+			want: false,
+		},
+		{
+			name: "unrelated path",
+			path: filepath.Join(t.TempDir(), "Teleport", "tsh.exe"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isPerMachineInstallPath(tt.path, prefixes))
+		})
+	}
+}
+
+func TestDownloadToRefusesPerMachineInstall(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("per-machine install detection is windows-only")
+	}
+
+	programFiles := t.TempDir()
+	t.Setenv("ProgramFiles", programFiles)
+
+	updater := NewUpdater(t.TempDir(), "3.2.1")
+	_, err := updater.DownloadTo(context.Background(), "3.2.1", filepath.Join(programFiles, "Teleport"))
+	require.True(t, trace.IsAccessDenied(err))
+}
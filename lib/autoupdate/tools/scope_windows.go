@@ -0,0 +1,53 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/gravitational/trace"
+)
+
+// userToolsDir returns the default per-user tools directory. Updater-managed
+// versions are always installed under %LOCALAPPDATA% so that updates never
+// require elevation, regardless of where the running binary came from.
+func userToolsDir() (string, error) {
+	localAppData := os.Getenv("LOCALAPPDATA")
+	if localAppData == "" {
+		var err error
+		localAppData, err = os.UserCacheDir()
+		if err != nil {
+			return "", trace.Wrap(err)
+		}
+	}
+
+	return filepath.Join(localAppData, "Teleport", "bin"), nil
+}
+
+// isPerMachineInstall reports whether path is under a system-wide
+// installation prefix (Program Files), e.g. a per-machine MSI install.
+// Writing there requires elevation and must never be attempted by the
+// updater; the system install is left untouched and the per-user managed
+// copy is used instead.
+func isPerMachineInstall(path string) bool {
+	return isPerMachineInstallPath(path, []string{
+		os.Getenv("ProgramFiles"),
+		os.Getenv("ProgramFiles(x86)"),
+		os.Getenv("ProgramW6432"),
+	})
+}
@@ -0,0 +1,48 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"errors"
+
+	"github.com/gravitational/trace"
+)
+
+// ErrInsecureToolsDir designates an error when the tools directory is owned
+// by another user or is group/world-writable, making binaries executed from
+// it a privilege-escalation vector.
+var ErrInsecureToolsDir = errors.New("tools directory has insecure ownership or permissions")
+
+// WithAllowInsecureToolsDir disables the ownership and permission checks of
+// the tools directory for unusual setups, e.g. a shared pre-staged volume
+// whose contents are trusted by other means. Use with care: binaries from a
+// directory writable by other users are executed as the current user.
+func WithAllowInsecureToolsDir() Option {
+	return func(u *Updater) {
+		u.allowInsecureDir = true
+	}
+}
+
+// checkSecureDir verifies that dir is safe to install to and execute
+// binaries from, unless the check was explicitly disabled with
+// [WithAllowInsecureToolsDir].
+func (u *Updater) checkSecureDir(dir string) error {
+	if u.allowInsecureDir {
+		return nil
+	}
+	return trace.Wrap(checkToolsDirSecure(dir))
+}
@@ -0,0 +1,57 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !windows
+
+package tools
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+
+	"github.com/gravitational/trace"
+)
+
+// checkToolsDirSecure verifies that dir is owned by the current user (or
+// root) and is not group/world-writable. A directory that other users can
+// write to lets them plant binaries that would be auto-executed as the
+// current user.
+func checkToolsDirSecure(dir string) error {
+	fi, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		// A directory that does not exist yet is created by the updater
+		// with safe permissions.
+		return nil
+	}
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return trace.BadParameter("failed to determine ownership of %q", dir)
+	}
+	if uid := int(stat.Uid); uid != os.Getuid() && uid != 0 {
+		return trace.Wrap(ErrInsecureToolsDir, "%q is owned by another user (uid %v)", dir, uid)
+	}
+	if fi.Mode().Perm()&0o022 != 0 {
+		return trace.Wrap(ErrInsecureToolsDir, "%q is group or world-writable (%v)", dir, fi.Mode().Perm())
+	}
+
+	return nil
+}
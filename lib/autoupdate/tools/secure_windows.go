@@ -0,0 +1,109 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"unsafe"
+
+	"github.com/gravitational/trace"
+	"golang.org/x/sys/windows"
+)
+
+// writeAccessMask covers the access rights that let a principal replace or
+// plant binaries in the directory, or rewrite its security descriptor to
+// grant themselves such rights.
+const writeAccessMask = windows.FILE_WRITE_DATA | windows.FILE_APPEND_DATA |
+	windows.FILE_WRITE_EA | windows.FILE_WRITE_ATTRIBUTES |
+	windows.DELETE | windows.WRITE_DAC | windows.WRITE_OWNER |
+	windows.GENERIC_WRITE | windows.GENERIC_ALL
+
+// checkToolsDirSecure verifies that dir is owned by the current user, the
+// built-in Administrators group or SYSTEM, and that its DACL does not grant
+// write access to anyone else. A directory writable by another user lets
+// them plant binaries that would be auto-executed as the current user.
+func checkToolsDirSecure(dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		// A directory that does not exist yet is created by the updater
+		// with a default security descriptor inherited from the per-user
+		// profile directory.
+		return nil
+	} else if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	sd, err := windows.GetNamedSecurityInfo(dir, windows.SE_FILE_OBJECT,
+		windows.OWNER_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	owner, _, err := sd.Owner()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	token := windows.GetCurrentProcessToken()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	ownerTrusted := owner.IsWellKnown(windows.WinBuiltinAdministratorsSid) ||
+		owner.IsWellKnown(windows.WinLocalSystemSid) ||
+		windows.EqualSid(owner, user.User.Sid)
+	if !ownerTrusted {
+		return trace.Wrap(ErrInsecureToolsDir, "%q is owned by another user (%v)", dir, owner)
+	}
+
+	return trace.Wrap(checkToolsDirDACL(sd, dir, owner, user.User.Sid))
+}
+
+// checkToolsDirDACL verifies that no ACE of the directory DACL grants write
+// access to a principal other than the owner, the current user, the built-in
+// Administrators group or SYSTEM. A write ACE for Everyone or Authenticated
+// Users makes the ownership check above meaningless.
+func checkToolsDirDACL(sd *windows.SECURITY_DESCRIPTOR, dir string, owner, user *windows.SID) error {
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if dacl == nil {
+		// A NULL DACL grants full access to everyone.
+		return trace.Wrap(ErrInsecureToolsDir, "%q has no DACL, granting everyone full access", dir)
+	}
+
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err := windows.GetAce(dacl, i, &ace); err != nil {
+			return trace.Wrap(err)
+		}
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE || ace.Mask&writeAccessMask == 0 {
+			continue
+		}
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		if windows.EqualSid(sid, owner) || windows.EqualSid(sid, user) ||
+			sid.IsWellKnown(windows.WinBuiltinAdministratorsSid) ||
+			sid.IsWellKnown(windows.WinLocalSystemSid) ||
+			sid.IsWellKnown(windows.WinCreatorOwnerSid) {
+			continue
+		}
+		return trace.Wrap(ErrInsecureToolsDir, "%q grants write access to %v", dir, sid)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/gravitational/trace"
+)
+
+// ArtifactRef identifies an artifact hosted on a release mirror.
+type ArtifactRef struct {
+	// Version is the client tools version the artifact belongs to, empty
+	// for version-independent artifacts such as the release index.
+	Version string
+	// Name is the file name of the artifact under the mirror root, e.g.
+	// "teleport-v1.2.3-linux-amd64-bin.tar.gz" or the matching ".sha256"
+	// checksum.
+	Name string
+}
+
+// Transport abstracts the fetch layer of the updater so artifacts can be
+// served from mirrors other than an HTTP CDN, e.g. S3, GCS or an OCI
+// registry. Implementations return the artifact content, its size when known
+// (-1 otherwise), and a trace.NotFound error for artifacts that do not
+// exist, which the updater relies on for negative-result caching.
+type Transport interface {
+	// Get fetches the referenced artifact.
+	Get(ctx context.Context, ref ArtifactRef) (io.ReadCloser, int64, error)
+}
+
+// WithTransport overrides how artifacts are fetched, replacing the default
+// HTTP transport that downloads them from the configured base URL.
+func WithTransport(transport Transport) Option {
+	return func(u *Updater) {
+		u.transport = transport
+	}
+}
+
+// httpTransport is the default [Transport] fetching artifacts from an HTTP
+// CDN under a base URL.
+type httpTransport struct {
+	baseURL string
+	client  *http.Client
+}
+
+// Get fetches the referenced artifact from the CDN.
+func (t *httpTransport) Get(ctx context.Context, ref ArtifactRef) (io.ReadCloser, int64, error) {
+	url := t.baseURL + "/" + ref.Name
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, trace.Wrap(err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, 0, trace.Wrap(err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, trace.NotFound("artifact %q not found", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, trace.BadParameter("bad status while downloading %q: %v", url, resp.StatusCode)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// artifactTransport returns the configured transport, falling back to the
+// default HTTP transport for the configured base URL.
+func (u *Updater) artifactTransport() Transport {
+	if u.transport != nil {
+		return u.transport
+	}
+	return &httpTransport{baseURL: u.baseURL, client: u.client}
+}
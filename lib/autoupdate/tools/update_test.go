@@ -0,0 +1,438 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/gravitational/teleport/lib/autoupdate/tools"
+	"github.com/gravitational/teleport/lib/autoupdate/tools/updatetest"
+)
+
+const testVersion = "3.2.1"
+
+func toolsForTest() map[string]string {
+	files := make(map[string]string)
+	for _, tool := range tools.DefaultClientTools() {
+		files[tool] = tool + "-" + testVersion
+	}
+	return files
+}
+
+func newTestCDN(t *testing.T, options ...updatetest.ServerOption) *updatetest.Server {
+	t.Helper()
+	srv := updatetest.NewServer(options...)
+	t.Cleanup(srv.Close)
+	require.NoError(t, srv.AddVersion(testVersion, toolsForTest()))
+	return srv
+}
+
+func TestUpdateInstallsTools(t *testing.T) {
+	srv := newTestCDN(t)
+	toolsDir := t.TempDir()
+
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	require.NoError(t, updater.Update(context.Background(), testVersion))
+
+	for tool, expected := range toolsForTest() {
+		data, err := os.ReadFile(filepath.Join(toolsDir, tool))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(data))
+	}
+
+	// The manifest must record the installed version and a checksum for
+	// every installed tool.
+	data, err := os.ReadFile(filepath.Join(toolsDir, ".update-manifest.json"))
+	require.NoError(t, err)
+	var m struct {
+		Version   string            `json:"version"`
+		Checksums map[string]string `json:"checksums"`
+	}
+	require.NoError(t, json.Unmarshal(data, &m))
+	require.Equal(t, testVersion, m.Version)
+	require.Len(t, m.Checksums, len(tools.DefaultClientTools()))
+}
+
+func TestUpdateRefusesUnmanagedTools(t *testing.T) {
+	srv := newTestCDN(t)
+	toolsDir := t.TempDir()
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	ctx := context.Background()
+
+	// A custom-built tool dropped into the tools directory by hand must
+	// never be replaced by the updater.
+	customTool := filepath.Join(toolsDir, tools.DefaultClientTools()[0])
+	require.NoError(t, os.WriteFile(customTool, []byte("custom build"), 0o755))
+	err := updater.Update(ctx, testVersion)
+	require.ErrorIs(t, err, tools.ErrUnmanagedTool)
+
+	// With the force overwrite option the custom build is replaced.
+	force := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()), tools.WithForceOverwrite())
+	require.NoError(t, force.Update(ctx, testVersion))
+
+	// A tool modified after installation is refused as well.
+	require.NoError(t, os.WriteFile(customTool, []byte("patched"), 0o755))
+	err = updater.Update(ctx, testVersion)
+	require.ErrorIs(t, err, tools.ErrToolModified)
+
+	// Untouched updater-installed tools can be replaced freely.
+	require.NoError(t, force.Update(ctx, testVersion))
+	require.NoError(t, updater.Update(ctx, testVersion))
+}
+
+func TestUpdateCorruptArchive(t *testing.T) {
+	srv := newTestCDN(t, updatetest.WithCorruptArchives())
+	toolsDir := t.TempDir()
+
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	err := updater.Update(context.Background(), testVersion)
+	require.Error(t, err)
+
+	// Nothing must be installed from an archive that failed verification.
+	for tool := range toolsForTest() {
+		_, err := os.Stat(filepath.Join(toolsDir, tool))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
+func TestDownloadTo(t *testing.T) {
+	srv := newTestCDN(t)
+	toolsDir := t.TempDir()
+	destDir := t.TempDir()
+
+	// Pre-staging into an arbitrary directory must leave the tools
+	// directory untouched and report the installed files.
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	m, err := updater.DownloadTo(context.Background(), testVersion, destDir)
+	require.NoError(t, err)
+	require.Equal(t, testVersion, m.Version)
+	require.Len(t, m.Checksums, len(tools.DefaultClientTools()))
+
+	for tool, expected := range toolsForTest() {
+		data, err := os.ReadFile(filepath.Join(destDir, tool))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(data))
+
+		_, err = os.Stat(filepath.Join(toolsDir, tool))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
+func TestUpdateCachedArchiveReuse(t *testing.T) {
+	srv := newTestCDN(t)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	updater := tools.NewUpdater(t.TempDir(), "1.0.0",
+		tools.WithBaseURL(srv.URL()), tools.WithCacheDir(cacheDir))
+	require.NoError(t, updater.Update(ctx, testVersion))
+
+	// With the archive cached, another profile can install the same
+	// version with no network at all.
+	srv.Close()
+	offline := tools.NewUpdater(t.TempDir(), "1.0.0",
+		tools.WithBaseURL(srv.URL()), tools.WithCacheDir(cacheDir))
+	require.NoError(t, offline.Update(ctx, testVersion))
+}
+
+func TestUpdateCacheEviction(t *testing.T) {
+	srv := newTestCDN(t)
+	otherVersion := "3.2.2"
+	otherFiles := make(map[string]string)
+	for _, tool := range tools.DefaultClientTools() {
+		otherFiles[tool] = tool + "-" + otherVersion
+	}
+	require.NoError(t, srv.AddVersion(otherVersion, otherFiles))
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	// A single archive exceeds the one byte limit, so installing the
+	// second version must evict the first while keeping the archive that
+	// was just installed.
+	updater := tools.NewUpdater(t.TempDir(), "1.0.0",
+		tools.WithBaseURL(srv.URL()), tools.WithCacheDir(cacheDir), tools.WithCacheSizeLimit(1))
+	require.NoError(t, updater.Update(ctx, testVersion))
+	require.NoError(t, updater.Update(ctx, otherVersion))
+
+	var archives int
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		// Only the content-addressed archives count; checksum records
+		// and the cache lock file are never evicted.
+		if len(entry.Name()) != hex.EncodedLen(sha256.Size) {
+			continue
+		}
+		if _, err := hex.DecodeString(entry.Name()); err != nil {
+			continue
+		}
+		archives++
+	}
+	require.Equal(t, 1, archives)
+}
+
+// mapTransport serves artifacts from memory, standing in for a custom
+// mirror such as S3 or GCS.
+type mapTransport struct {
+	artifacts map[string][]byte
+}
+
+func (t *mapTransport) Get(ctx context.Context, ref tools.ArtifactRef) (io.ReadCloser, int64, error) {
+	data, ok := t.artifacts[ref.Name]
+	if !ok {
+		return nil, 0, trace.NotFound("artifact %q not found", ref.Name)
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func TestUpdateCustomTransport(t *testing.T) {
+	archive, err := updatetest.BuildArchive(toolsForTest())
+	require.NoError(t, err)
+	name, err := tools.ArchiveName(testVersion, runtime.GOOS, runtime.GOARCH)
+	require.NoError(t, err)
+	hash := sha256.Sum256(archive)
+
+	transport := &mapTransport{artifacts: map[string][]byte{
+		name:             archive,
+		name + ".sha256": []byte(hex.EncodeToString(hash[:])),
+	}}
+
+	toolsDir := t.TempDir()
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithTransport(transport))
+	require.NoError(t, updater.Update(context.Background(), testVersion))
+
+	for tool, expected := range toolsForTest() {
+		data, err := os.ReadFile(filepath.Join(toolsDir, tool))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(data))
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	srv := newTestCDN(t)
+	toolsDir := t.TempDir()
+	ctx := context.Background()
+
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	require.NoError(t, updater.Update(ctx, testVersion))
+
+	t.Setenv("TELEPORT_TOOLS_VERSION", testVersion)
+	report := updater.Diagnose(ctx)
+	require.True(t, report.OK(), report.String())
+	require.Equal(t, toolsDir, report.ToolsDir)
+	require.Equal(t, testVersion, report.InstalledVersion)
+	require.Equal(t, testVersion, report.PinnedVersion)
+	require.NotEmpty(t, report.String())
+
+	// A pin on a version missing from the mirror must be flagged.
+	t.Setenv("TELEPORT_TOOLS_VERSION", "9.9.9")
+	report = updater.Diagnose(ctx)
+	require.False(t, report.OK())
+
+	// With the CDN gone, the connectivity check fails too.
+	srv.Close()
+	t.Setenv("TELEPORT_TOOLS_VERSION", "")
+	report = updater.Diagnose(ctx)
+	require.False(t, report.OK())
+}
+
+// recordingSink collects emitted updater events.
+type recordingSink struct {
+	events []tools.Event
+}
+
+func (s *recordingSink) Emit(ctx context.Context, event tools.Event) {
+	s.events = append(s.events, event)
+}
+
+func TestWarnOnOutdatedPin(t *testing.T) {
+	ctx := context.Background()
+	sink := &recordingSink{}
+	updater := tools.NewUpdater(t.TempDir(), "1.0.0", tools.WithEventSink(sink))
+
+	// A pin older than the cluster target emits an event.
+	t.Setenv("TELEPORT_TOOLS_VERSION", "1.0.0")
+	updater.WarnOnOutdatedPin(ctx, "2.0.0")
+	require.Len(t, sink.events, 1)
+	require.Equal(t, tools.EventOutdatedPin, sink.events[0].Kind)
+	require.Equal(t, "1.0.0", sink.events[0].PinnedVersion)
+	require.Equal(t, "2.0.0", sink.events[0].TargetVersion)
+
+	// An up-to-date pin, a disabled updater and no pin at all stay quiet.
+	updater.WarnOnOutdatedPin(ctx, "1.0.0")
+	t.Setenv("TELEPORT_TOOLS_VERSION", "off")
+	updater.WarnOnOutdatedPin(ctx, "2.0.0")
+	t.Setenv("TELEPORT_TOOLS_VERSION", "")
+	updater.WarnOnOutdatedPin(ctx, "2.0.0")
+	require.Len(t, sink.events, 1)
+}
+
+func TestUpdateVersionNotFound(t *testing.T) {
+	srv := newTestCDN(t)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	updater := tools.NewUpdater(t.TempDir(), "1.0.0",
+		tools.WithBaseURL(srv.URL()), tools.WithCacheDir(cacheDir))
+	err := updater.Update(ctx, "9.9.9")
+	require.ErrorIs(t, err, tools.ErrVersionNotFound)
+	// The release index only contains testVersion, which is suggested as
+	// the closest available version.
+	require.ErrorContains(t, err, testVersion)
+
+	// The negative result is cached, subsequent runs fail fast without
+	// re-querying the CDN.
+	srv.Close()
+	err = updater.Update(ctx, "9.9.9")
+	require.ErrorIs(t, err, tools.ErrVersionNotFound)
+	require.ErrorContains(t, err, testVersion)
+}
+
+func TestUpdateInsecureToolsDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission bits are not meaningful on windows")
+	}
+	srv := newTestCDN(t)
+	toolsDir := t.TempDir()
+	require.NoError(t, os.Chmod(toolsDir, 0o777))
+	ctx := context.Background()
+
+	// A world-writable tools directory is a privilege-escalation vector
+	// and must be refused.
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	err := updater.Update(ctx, testVersion)
+	require.ErrorIs(t, err, tools.ErrInsecureToolsDir)
+
+	// The explicit override allows unusual setups to proceed.
+	insecure := tools.NewUpdater(toolsDir, "1.0.0",
+		tools.WithBaseURL(srv.URL()), tools.WithAllowInsecureToolsDir())
+	require.NoError(t, insecure.Update(ctx, testVersion))
+}
+
+func TestUpdateSharedCacheConcurrency(t *testing.T) {
+	srv := newTestCDN(t)
+	otherVersion := "3.2.2"
+	otherFiles := make(map[string]string)
+	for _, tool := range tools.DefaultClientTools() {
+		otherFiles[tool] = tool + "-" + otherVersion
+	}
+	require.NoError(t, srv.AddVersion(otherVersion, otherFiles))
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	// Two profiles share one cache directory while installing different
+	// versions under a tiny size limit, forcing constant eviction. The
+	// cache lock keeps one process's prune from deleting the archive the
+	// other is about to extract.
+	var group errgroup.Group
+	for _, version := range []string{testVersion, otherVersion} {
+		updater := tools.NewUpdater(t.TempDir(), "1.0.0",
+			tools.WithBaseURL(srv.URL()), tools.WithCacheDir(cacheDir), tools.WithCacheSizeLimit(1))
+		group.Go(func() error {
+			for i := 0; i < 5; i++ {
+				if err := updater.Update(ctx, version); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	require.NoError(t, group.Wait())
+}
+
+func TestUpdateFaultInjection(t *testing.T) {
+	srv := newTestCDN(t)
+	toolsDir := t.TempDir()
+	ctx := context.Background()
+
+	// Cut the connection after the first chunk of the archive body was
+	// read to simulate a mid-download disconnect.
+	var chunks int
+	disconnect := errors.New("injected disconnect")
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()),
+		tools.WithFaultHook(func(point tools.FaultPoint) error {
+			if point == tools.FaultDownloadChunk {
+				chunks++
+				return disconnect
+			}
+			return nil
+		}))
+	err := updater.Update(ctx, testVersion)
+	require.ErrorIs(t, err, disconnect)
+	require.Equal(t, 1, chunks)
+
+	// Nothing must be installed and no partial downloads left behind in
+	// the cache directory where the temporary files are created.
+	entries, err := os.ReadDir(filepath.Join(toolsDir, "cache"))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), "download-")
+	}
+
+	// A retry without faults recovers.
+	retry := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	require.NoError(t, retry.Update(ctx, testVersion))
+}
+
+func TestUpdateMalformedChecksum(t *testing.T) {
+	srv := newTestCDN(t, updatetest.WithMalformedChecksums())
+	toolsDir := t.TempDir()
+
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	err := updater.Update(context.Background(), testVersion)
+	require.ErrorContains(t, err, "not hex-encoded")
+}
+
+func TestUpdateSlowCDN(t *testing.T) {
+	latency := 100 * time.Millisecond
+	srv := newTestCDN(t, updatetest.WithLatency(latency))
+	toolsDir := t.TempDir()
+
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	start := time.Now()
+	require.NoError(t, updater.Update(context.Background(), testVersion))
+	require.GreaterOrEqual(t, time.Since(start), latency)
+}
+
+func TestUpdateTransientFailures(t *testing.T) {
+	srv := newTestCDN(t, updatetest.WithFailureCount(1, http.StatusServiceUnavailable))
+	toolsDir := t.TempDir()
+
+	updater := tools.NewUpdater(toolsDir, "1.0.0", tools.WithBaseURL(srv.URL()))
+	ctx := context.Background()
+
+	// The first attempt hits the injected failure, the second succeeds
+	// once the fake CDN recovers.
+	require.Error(t, updater.Update(ctx, testVersion))
+	require.NoError(t, updater.Update(ctx, testVersion))
+}
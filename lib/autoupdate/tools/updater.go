@@ -0,0 +1,361 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package tools implements the client tools auto-update logic. It downloads,
+// verifies and installs versions of the client tools (tsh, tctl) into the
+// tools directory ($TELEPORT_HOME/bin) and keeps track of the files it owns
+// so that manually installed binaries are never silently replaced.
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/utils"
+)
+
+const (
+	// teleportToolsVersionEnv is the environment variable used to pin the
+	// client tools to a specific version or disable updates ("off").
+	teleportToolsVersionEnv = "TELEPORT_TOOLS_VERSION"
+	// defaultBaseURL is the CDN used by the updater to download releases
+	// when no custom base URL is configured.
+	defaultBaseURL = "https://cdn.teleport.dev"
+	// lockFileName is the name of the file used to synchronize concurrent
+	// updates of the tools directory.
+	lockFileName = ".lock"
+	// lockTimeout is the maximum amount of time the updater waits for the
+	// tools directory lock held by another process.
+	lockTimeout = 10 * time.Minute
+)
+
+// Option applies an option value for the Updater.
+type Option func(u *Updater)
+
+// WithBaseURL defines the base URL for downloading the client tools,
+// overriding the default CDN address.
+func WithBaseURL(baseURL string) Option {
+	return func(u *Updater) {
+		u.baseURL = baseURL
+	}
+}
+
+// WithClient defines the HTTP client used by the Updater.
+func WithClient(client *http.Client) Option {
+	return func(u *Updater) {
+		u.client = client
+	}
+}
+
+// WithTools defines the list of tool binaries managed by the Updater
+// in the tools directory.
+func WithTools(tools []string) Option {
+	return func(u *Updater) {
+		u.tools = tools
+	}
+}
+
+// WithCacheDir overrides the directory keeping verified downloaded archives,
+// which defaults to the "cache" subdirectory of the tools directory. Pointing
+// multiple profiles at a shared cache directory lets them reuse downloads.
+func WithCacheDir(cacheDir string) Option {
+	return func(u *Updater) {
+		u.cacheDir = cacheDir
+	}
+}
+
+// WithCacheSizeLimit overrides the total size of cached archives before the
+// least recently used ones are evicted. A zero or negative limit disables
+// eviction.
+func WithCacheSizeLimit(sizeLimit int64) Option {
+	return func(u *Updater) {
+		u.cacheSizeLimit = sizeLimit
+	}
+}
+
+// WithForceOverwrite allows the Updater to replace binaries in the tools
+// directory that it did not install or that were modified after installation.
+// Without this option such binaries are left untouched and the update fails
+// with [ErrUnmanagedTool] or [ErrToolModified].
+func WithForceOverwrite() Option {
+	return func(u *Updater) {
+		u.forceOverwrite = true
+	}
+}
+
+// Updater manages the installation of client tools into the tools directory.
+type Updater struct {
+	toolsDir     string
+	localVersion string
+	tools        []string
+
+	baseURL          string
+	client           *http.Client
+	transport        Transport
+	forceOverwrite   bool
+	faultHook        FaultHook
+	cacheDir         string
+	cacheSizeLimit   int64
+	allowInsecureDir bool
+	eventSink        EventSink
+}
+
+// NewUpdater initializes the updater for the given tools directory and the
+// currently running version of the client tools. Defaults may be overridden
+// with options.
+func NewUpdater(toolsDir, localVersion string, options ...Option) *Updater {
+	updater := &Updater{
+		toolsDir:       toolsDir,
+		localVersion:   localVersion,
+		tools:          DefaultClientTools(),
+		baseURL:        defaultBaseURL,
+		client:         http.DefaultClient,
+		cacheDir:       filepath.Join(toolsDir, cacheDirName),
+		cacheSizeLimit: defaultCacheSizeLimit,
+	}
+	for _, option := range options {
+		option(updater)
+	}
+
+	return updater
+}
+
+// Update acquires the tools directory lock and installs the requested version
+// of the client tools into the tools directory. Binaries that were not
+// installed by the updater, or that were modified since installation, are
+// never replaced unless the updater was created with [WithForceOverwrite].
+func (u *Updater) Update(ctx context.Context, toolsVersion string) error {
+	_, err := u.DownloadTo(ctx, toolsVersion, u.toolsDir)
+	return trace.Wrap(err)
+}
+
+// DownloadTo fetches, verifies and extracts the requested version of the
+// client tools into destDir without activating it, using the same
+// verification pipeline and ownership checks as [Updater.Update]. It is
+// meant for pre-staging a specific version into a container image or a
+// shared volume, and returns the manifest of the installed files.
+func (u *Updater) DownloadTo(ctx context.Context, toolsVersion, destDir string) (m *Manifest, err error) {
+	// A per-machine system install (e.g. under Program Files on Windows)
+	// requires elevation to modify and is never managed by the updater;
+	// managed versions belong in the per-user tools directory.
+	if isPerMachineInstall(destDir) {
+		return nil, trace.AccessDenied("refusing to manage client tools in per-machine install location %q", destDir)
+	}
+	if err := u.checkSecureDir(destDir); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	// Use a filesystem lock to allow multiple concurrent processes to
+	// execute updates without overwriting each other's files.
+	unlock, err := utils.FSTryWriteLockTimeout(ctx, filepath.Join(destDir, lockFileName), lockTimeout)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer func() {
+		err = trace.NewAggregate(err, unlock())
+	}()
+	if err := u.fault(FaultAcquireLock); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if !u.forceOverwrite {
+		if err := u.checkOwnership(destDir); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+
+	m, err = u.update(ctx, toolsVersion, destDir)
+	return m, trace.Wrap(err)
+}
+
+// update downloads the archive for the requested version, verifies its
+// checksum, extracts it into destDir and records the installed files in the
+// manifest. The caller must hold the destination directory lock.
+func (u *Updater) update(ctx context.Context, toolsVersion, destDir string) (m *Manifest, err error) {
+	name, err := ArchiveName(toolsVersion, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	// The cache directory may be shared between profiles whose updates
+	// are serialized by different destination locks, so it is locked
+	// separately for the whole fetch-and-extract sequence to keep
+	// eviction and negative-lookup updates of one process from racing
+	// another.
+	if err := os.MkdirAll(u.cacheDir, 0o755); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	unlockCache, err := utils.FSTryWriteLockTimeout(ctx, filepath.Join(u.cacheDir, lockFileName), lockTimeout)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer func() {
+		err = trace.NewAggregate(err, unlockCache())
+	}()
+
+	// Previously fetched archives are kept in a content-addressed cache
+	// along with their checksums, re-installing a fully cached version
+	// requires no network round trips at all.
+	cache := &archiveCache{dir: u.cacheDir, sizeLimit: u.cacheSizeLimit}
+	var archivePath string
+	hash, err := cache.getHash(name)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if hash != "" {
+		if archivePath, err = cache.get(hash); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	if archivePath == "" {
+		// Recently failed lookups are remembered with a short TTL to
+		// fail fast instead of re-querying the CDN on every run.
+		entry, err := cache.getNotFound(name)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if entry != nil {
+			return nil, versionNotFoundError(toolsVersion, entry.Suggestion)
+		}
+		checksumRef := ArtifactRef{Version: toolsVersion, Name: name + ".sha256"}
+		if hash, err = u.downloadHash(ctx, checksumRef); trace.IsNotFound(err) {
+			suggestion := u.suggestVersion(ctx, toolsVersion)
+			if err := cache.putNotFound(name, suggestion); err != nil {
+				return nil, trace.Wrap(err)
+			}
+			return nil, versionNotFoundError(toolsVersion, suggestion)
+		} else if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if archivePath, err = cache.get(hash); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	if archivePath == "" {
+		downloadPath, err := u.downloadArchive(ctx, ArtifactRef{Version: toolsVersion, Name: name}, hash)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if archivePath, err = cache.put(downloadPath, hash); err != nil {
+			if rmErr := os.Remove(downloadPath); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
+				return nil, trace.NewAggregate(err, rmErr)
+			}
+			return nil, trace.Wrap(err)
+		}
+	} else {
+		slog.DebugContext(ctx, "Using cached archive", "path", archivePath)
+	}
+	if err := cache.putHash(name, hash); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if err := u.fault(FaultExtract); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := extractPackage(archivePath, destDir); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	m, err = u.writeManifest(destDir, toolsVersion)
+	return m, trace.Wrap(err)
+}
+
+// downloadHash downloads the hex-encoded SHA256 checksum published next to
+// the release archive.
+func (u *Updater) downloadHash(ctx context.Context, ref ArtifactRef) (string, error) {
+	body, _, err := u.artifactTransport().Get(ctx, ref)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer body.Close()
+
+	// The checksum file contains the hex-encoded hash optionally followed
+	// by the file name, only the hash itself is read.
+	hash := make([]byte, sha256.Size*2)
+	if _, err := io.ReadFull(body, hash); err != nil {
+		return "", trace.Wrap(err)
+	}
+	if _, err := hex.DecodeString(string(hash)); err != nil {
+		return "", trace.Wrap(err, "checksum of %q is not hex-encoded", ref.Name)
+	}
+
+	return string(hash), nil
+}
+
+// downloadArchive downloads the release archive into a temporary file in the
+// cache directory and verifies it against the expected checksum. The caller
+// moves the returned file into the cache, or removes it on failure.
+func (u *Updater) downloadArchive(ctx context.Context, ref ArtifactRef, hash string) (path string, err error) {
+	if err := u.fault(FaultDownloadStart); err != nil {
+		return "", trace.Wrap(err)
+	}
+	respBody, _, err := u.artifactTransport().Get(ctx, ref)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer respBody.Close()
+
+	// The file is first downloaded under a temporary name and moved into
+	// the cache only after the checksum was verified to never leave
+	// partially downloaded data behind under a content-addressed name.
+	if err := os.MkdirAll(u.cacheDir, 0o755); err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+	f, err := os.CreateTemp(u.cacheDir, "download-*")
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	h := sha256.New()
+	body := io.Reader(respBody)
+	if u.faultHook != nil {
+		body = &faultReader{reader: body, fault: u.fault}
+	}
+	if _, err := io.Copy(io.MultiWriter(f, h), body); err != nil {
+		return "", trace.Wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return "", trace.Wrap(err)
+	}
+	if err := u.fault(FaultVerifyChecksum); err != nil {
+		return "", trace.Wrap(err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return "", trace.CompareFailed("checksum of downloaded archive %q does not match %q", ref.Name, hash)
+	}
+
+	return f.Name(), nil
+}
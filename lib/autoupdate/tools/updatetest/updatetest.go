@@ -0,0 +1,244 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package updatetest provides test fixtures for the client tools updater:
+// archive builders and a fake CDN server with configurable latency, failure
+// injection and malformed-artifact modes. It is exported so that other
+// components embedding the updater can reuse the same fixtures in their own
+// tests instead of re-implementing them.
+package updatetest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/autoupdate/tools"
+)
+
+// BuildTarGzArchive assembles a gzip-compressed tarball with the given file
+// names and contents, each marked executable, matching the layout of the
+// client tools release archives for linux and darwin.
+func BuildTarGzArchive(files map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0o755,
+			Size: int64(len(data)),
+		})
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// BuildZipArchive assembles a zip archive with the given file names and
+// contents, matching the layout of the client tools release archives for
+// windows.
+func BuildZipArchive(files map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// BuildArchive assembles a release archive in the format the updater expects
+// on the current platform.
+func BuildArchive(files map[string]string) ([]byte, error) {
+	if runtime.GOOS == "windows" {
+		return BuildZipArchive(files)
+	}
+	return BuildTarGzArchive(files)
+}
+
+// ServerOption applies an option value for the fake CDN [Server].
+type ServerOption func(s *Server)
+
+// WithLatency delays every response of the server by d, simulating a slow
+// network or CDN edge.
+func WithLatency(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.latency = d
+	}
+}
+
+// WithFailureCount makes the first count requests fail with the given HTTP
+// status code before the server starts responding normally, simulating
+// transient CDN outages.
+func WithFailureCount(count int, statusCode int) ServerOption {
+	return func(s *Server) {
+		s.failuresLeft = count
+		s.failureCode = statusCode
+	}
+}
+
+// WithMalformedChecksums makes the server respond to checksum requests with
+// data that is not a valid hex-encoded SHA256 hash.
+func WithMalformedChecksums() ServerOption {
+	return func(s *Server) {
+		s.malformedChecksums = true
+	}
+}
+
+// WithCorruptArchives makes the server serve archives whose contents do not
+// match the advertised checksum, exercising the verification failure path.
+func WithCorruptArchives() ServerOption {
+	return func(s *Server) {
+		s.corruptArchives = true
+	}
+}
+
+// Server is a fake CDN serving generated client tools release archives and
+// their checksums over HTTP.
+type Server struct {
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	archives map[string][]byte
+	versions []string
+
+	latency            time.Duration
+	failuresLeft       int
+	failureCode        int
+	malformedChecksums bool
+	corruptArchives    bool
+}
+
+// NewServer starts a fake CDN with no versions registered, use
+// [Server.AddVersion] to publish them.
+func NewServer(options ...ServerOption) *Server {
+	s := &Server{
+		archives: make(map[string][]byte),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// URL returns the base URL of the fake CDN, suitable for the updater's
+// WithBaseURL option.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close shuts the fake CDN down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddVersion publishes a release archive for the given version on the
+// current platform with the given file contents.
+func (s *Server) AddVersion(version string, files map[string]string) error {
+	name, err := tools.ArchiveName(version, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	archive, err := BuildArchive(files)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archives["/"+name] = archive
+	s.versions = append(s.versions, version)
+
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+	s.mu.Lock()
+	if s.failuresLeft > 0 {
+		s.failuresLeft--
+		code := s.failureCode
+		s.mu.Unlock()
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	if r.URL.Path == "/releases" {
+		versions := strings.Join(s.versions, "\n")
+		s.mu.Unlock()
+		w.Write([]byte(versions))
+		return
+	}
+	name, isChecksum := strings.CutSuffix(r.URL.Path, ".sha256")
+	archive, found := s.archives[name]
+	s.mu.Unlock()
+
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if isChecksum {
+		if s.malformedChecksums {
+			// The full checksum length is served so clients reach
+			// their hex validation instead of failing on a short
+			// read.
+			w.Write([]byte(strings.Repeat("zz", sha256.Size)))
+			return
+		}
+		hash := sha256.Sum256(archive)
+		w.Write([]byte(hex.EncodeToString(hash[:])))
+		return
+	}
+	if s.corruptArchives {
+		archive = append(bytes.Clone(archive), "corrupted"...)
+	}
+	w.Write(archive)
+}
@@ -0,0 +1,163 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tools
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/utils"
+)
+
+// DefaultClientTools returns the list of client tool binaries managed by the
+// updater on the current platform.
+func DefaultClientTools() []string {
+	switch runtime.GOOS {
+	case "windows":
+		return []string{"tsh.exe", "tctl.exe"}
+	default:
+		return []string{"tsh", "tctl"}
+	}
+}
+
+// Dir returns the client tools directory: $TELEPORT_HOME/bin when the home
+// location is overridden, otherwise the per-user default of the current
+// platform ($HOME/.tsh/bin, or %LOCALAPPDATA%\Teleport\bin on Windows).
+func Dir() (string, error) {
+	if home := os.Getenv(types.HomeEnvVar); home != "" {
+		return filepath.Join(home, "bin"), nil
+	}
+
+	dir, err := userToolsDir()
+	return dir, trace.Wrap(err)
+}
+
+// ArchiveName returns the file name of the client tools release archive for
+// the given version, operating system and architecture. It is exported for
+// use by the updatetest fixtures and downstream consumers hosting their own
+// mirrors.
+func ArchiveName(toolsVersion, goos, arch string) (string, error) {
+	switch goos {
+	case "darwin", "linux":
+		return fmt.Sprintf("teleport-v%s-%s-%s-bin.tar.gz", toolsVersion, goos, arch), nil
+	case "windows":
+		return fmt.Sprintf("teleport-v%s-windows-%s-bin.zip", toolsVersion, arch), nil
+	default:
+		return "", trace.BadParameter("runtime %q is not supported", goos)
+	}
+}
+
+// extractPackage extracts the release archive at archivePath into dir,
+// dispatching on the archive format by file contents rather than name since
+// downloads are stored under content-addressed names. The archive is first
+// extracted into a temporary directory and then moved over the destination
+// files, replacing existing binaries with the same overwrite semantics on
+// all platforms.
+func extractPackage(archivePath, dir string) error {
+	tmpDir, err := os.MkdirTemp(dir, "extract-*")
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extractArchive(archivePath, tmpDir); err != nil {
+		return trace.Wrap(err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	for _, entry := range entries {
+		dst := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(dst); err != nil {
+			return trace.ConvertSystemError(err)
+		}
+		if err := os.Rename(filepath.Join(tmpDir, entry.Name()), dst); err != nil {
+			return trace.ConvertSystemError(err)
+		}
+	}
+
+	return nil
+}
+
+// extractArchive unpacks the archive at archivePath into dir.
+func extractArchive(archivePath, dir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer f.Close()
+
+	if gz, err := gzip.NewReader(f); err == nil {
+		defer gz.Close()
+		return trace.Wrap(utils.Extract(gz, dir))
+	}
+
+	return trace.Wrap(extractZip(archivePath, dir))
+}
+
+// extractZip extracts the zip archive at archivePath into dir, refusing to
+// write files outside of dir.
+func extractZip(archivePath, dir string) error {
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer zipReader.Close()
+
+	for _, zipFile := range zipReader.File {
+		path := filepath.Join(dir, filepath.Base(zipFile.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return trace.BadParameter("%q: illegal file path", zipFile.Name)
+		}
+		if zipFile.FileInfo().IsDir() {
+			continue
+		}
+		if err := copyZipFile(zipFile, path); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func copyZipFile(zipFile *zip.File, path string) error {
+	src, err := zipFile.Open()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, zipFile.Mode())
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return trace.Wrap(err)
+}